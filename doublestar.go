@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+//isRecursivePattern reports whether pattern uses the multi-segment glob
+//grammar (segments split on "/", where "**" matches zero or more of
+//them) instead of the plain single-directory glob.
+func isRecursivePattern(pattern string) bool {
+	return strings.Contains(pattern, "/")
+}
+
+//matchSegments matches path segments against pattern segments, where a
+//"**" segment matches zero or more path segments and any other segment
+//is matched against a single path segment with filepath.Match semantics.
+func matchSegments(pattern, path []string) (bool, error) {
+	switch {
+	case len(pattern) == 0:
+		return len(path) == 0, nil
+	case pattern[0] == "**":
+		if ok, err := matchSegments(pattern[1:], path); err != nil || ok {
+			return ok, err
+		}
+		if len(path) == 0 {
+			return false, nil
+		}
+		return matchSegments(pattern, path[1:])
+	case len(path) == 0:
+		return false, nil
+	default:
+		ok, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		return matchSegments(pattern[1:], path[1:])
+	}
+}
+
+//matchExclude reports whether relSegs should be excluded by exclude. A
+//"/"-segmented exclude is matched the same way as the main pattern; a
+//plain one is matched against the basename alone, at any depth, same as
+//the legacy single-directory filter.
+func matchExclude(exclude string, relSegs []string) (bool, error) {
+	if exclude == "" {
+		return false, nil
+	}
+	if isRecursivePattern(exclude) {
+		return matchSegments(strings.Split(exclude, "/"), relSegs)
+	}
+	return filepath.Match(exclude, relSegs[len(relSegs)-1])
+}
+
+//hasDotSegment reports whether any of segs starts with ".".
+func hasDotSegment(segs []string) bool {
+	for _, s := range segs {
+		if strings.HasPrefix(s, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+//walkMatch walks root and returns the absolute paths of regular files
+//whose path relative to root matches pattern but not exclude, both given
+//in the "/"-segmented, "**"-aware grammar. Unless includeDot is set,
+//dotfiles and dot directories are skipped at walk time. Any directory in
+//boundaries other than root itself is skipped along with its subtree:
+//these are other loaded packages' directories, so their files are left
+//for that package's own walk instead of being reported twice.
+func walkMatch(root, pattern, exclude string, includeDot bool, boundaries map[string]bool) ([]string, error) {
+	patSegs := strings.Split(pattern, "/")
+
+	var out []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if !includeDot && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if boundaries[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		relSegs := strings.Split(filepath.ToSlash(rel), "/")
+
+		ok, err := matchSegments(patSegs, relSegs)
+		if err != nil || !ok {
+			return err
+		}
+
+		skip, err := matchExclude(exclude, relSegs)
+		if err != nil || skip {
+			return err
+		}
+
+		out = append(out, path)
+		return nil
+	})
+	return out, err
+}
+
+//overlayWalkMatch is walkMatch's counterpart for overlay files: it unions
+//in overlay keys that live under root and match pattern but not exclude,
+//since they never surface from filepath.WalkDir itself. It honors
+//includeDot and boundaries the same way walkMatch does.
+func overlayWalkMatch(root, pattern, exclude string, overlay map[string]string, includeDot bool, boundaries map[string]bool) ([]string, error) {
+	if len(overlay) == 0 {
+		return nil, nil
+	}
+
+	patSegs := strings.Split(pattern, "/")
+
+	prefix := root + string(filepath.Separator)
+	var out []string
+	for logical := range overlay {
+		if !strings.HasPrefix(logical, prefix) {
+			continue
+		}
+		rel := strings.TrimPrefix(logical, prefix)
+		relSegs := strings.Split(filepath.ToSlash(rel), "/")
+
+		if !includeDot && hasDotSegment(relSegs) {
+			continue
+		}
+
+		if underBoundary(root, relSegs, boundaries) {
+			continue
+		}
+
+		ok, err := matchSegments(patSegs, relSegs)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		skip, err := matchExclude(exclude, relSegs)
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			continue
+		}
+
+		out = append(out, logical)
+	}
+	return out, nil
+}
+
+//underBoundary reports whether relSegs (relative to root) falls inside
+//one of boundaries, i.e. some other package's directory.
+func underBoundary(root string, relSegs []string, boundaries map[string]bool) bool {
+	dir := root
+	for _, seg := range relSegs[:len(relSegs)-1] {
+		dir = filepath.Join(dir, seg)
+		if boundaries[dir] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "a.go", true},
+		{"*.go", "sub/a.go", false},
+		{"**/*.go", "a.go", true},
+		{"**/*.go", "sub/a.go", true},
+		{"**/*.go", "sub/deeper/a.go", true},
+		{"**/*.go", "a.txt", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"**", "anything/at/all", true},
+		{"**", "", true},
+	}
+	for _, tc := range tests {
+		var path []string
+		if tc.path != "" {
+			path = strings.Split(tc.path, "/")
+		}
+		got, err := matchSegments(strings.Split(tc.pattern, "/"), path)
+		if err != nil {
+			t.Errorf("matchSegments(%q, %q): %v", tc.pattern, tc.path, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("matchSegments(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestMatchExclude(t *testing.T) {
+	tests := []struct {
+		exclude string
+		path    string
+		want    bool
+	}{
+		{"", "a/foo_test.go", false},
+		{"*_test.go", "foo_test.go", true},
+		{"*_test.go", "a/foo_test.go", true},
+		{"*_test.go", "a/sub/foo_test.go", true},
+		{"*_test.go", "a/foo.go", false},
+		{"**/testdata/**", "a/testdata/x.go", true},
+		{"**/testdata/**", "a/b/testdata/x.go", true},
+		{"**/testdata/**", "a/b/x.go", false},
+	}
+	for _, tc := range tests {
+		got, err := matchExclude(tc.exclude, strings.Split(tc.path, "/"))
+		if err != nil {
+			t.Errorf("matchExclude(%q, %q): %v", tc.exclude, tc.path, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("matchExclude(%q, %q) = %v, want %v", tc.exclude, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestHasDotSegment(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a/b/c", false},
+		{".git/config", true},
+		{"a/.hidden/b", true},
+		{"a/b/.hidden", true},
+	}
+	for _, tc := range tests {
+		if got := hasDotSegment(strings.Split(tc.path, "/")); got != tc.want {
+			t.Errorf("hasDotSegment(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestUnderBoundary(t *testing.T) {
+	boundaries := map[string]bool{
+		"/root/a": true,
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a/file.go", true},
+		{"a/sub/file.go", true},
+		{"b/file.go", false},
+		{"file.go", false},
+	}
+	for _, tc := range tests {
+		if got := underBoundary("/root", strings.Split(tc.path, "/"), boundaries); got != tc.want {
+			t.Errorf("underBoundary(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
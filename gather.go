@@ -16,12 +16,25 @@
 //To include standard library dependencies, use the -stdlib flag.
 //To not scan the dependencies, use the -no-deps flag.
 //
+//To present a virtual file tree to gather(1) without writing it to disk,
+//use the -overlay flag with a path to a JSON file of the same shape
+//accepted by go(1)'s -overlay flag: {"Replace": {"logical path": "actual path"}}.
+//Overlaid files participate in both package loading and globbing;
+//matched overlay files are reported under their logical path.
+//
 //Files are matched by globs as per godoc path/Filepath Match.
 //The default glob is "*", but to specify import paths you must first
 //specify the pattern.
+//If the pattern contains a "/", it is instead matched segment by segment
+//against each package directory's subtree, where a "**" segment matches
+//zero or more path segments and any other segment is matched as before;
+//this lets a pattern like "**/*.tmpl" reach files nested under a package.
 //By default, dotfiles are excluded.
-//To include dotfiles, use the -. flag.
-//To exclude matched files that match a second glob, use the -exclude flag.
+//To include dotfiles, use the -. flag; otherwise dotfiles and dot
+//directories are skipped as they're encountered, so a recursive pattern
+//never descends into them.
+//To exclude matched files that match a second glob, use the -exclude flag,
+//which accepts the same plain or "/"-segmented grammar as the pattern.
 //
 //By default, gather(1) prints the absolute path of each matched file.
 //To print matched files relative to a given path, use the -rel flag.
@@ -37,6 +50,29 @@
 //The -fail-on-dup flag will cause gather(1) to fail if two files
 //have the same name.
 //
+//Packages are matched concurrently, up to -j workers at a time (the
+//default is one worker per CPU). Results are printed as each package
+//finishes, which may reorder them relative to the package arguments;
+//pass -sort to print them back in that original order instead.
+//
+//Instead of printing matched files, -o DIR copies them into DIR; this
+//replaces a downstream xargs cp and sidesteps the duplicate-name problem
+//-fail-on-dup exists to detect. -copy-layout picks how each file is
+//placed under DIR: "flat" (the default, bare basename; combine with
+//-fail-on-dup), "import-path" (DIR/<import/path>/basename), or
+//"module-relative" (DIR/<path relative to the module root>). Copies are
+//written atomically, so an interrupted run never leaves a half-written
+//file in DIR.
+//
+//The -json flag emits one JSON object per matched file instead of plain
+//text, one per line: {"Path", "Rel", "Package", "Module", "Dir",
+//"Matched", "IsStdlib"}, mirroring the attribution go(1)'s list -json
+//gives a package. Add -json-array to wrap every object in a single
+//top-level array, for piping into jq, at the cost of buffering the
+//whole run's output before printing it; unlike plain -json, the array is
+//always in package order, regardless of -sort. -json is incompatible
+//with -o.
+//
 //EXAMPLES
 //
 //List all non-dot files in the package contained in the current directory,
@@ -56,55 +92,102 @@
 //List the absolute path of all dot files like ".git*" in the packages a/b/c, d/e/f, and g/h/...
 //ignoring any dependencies
 //	gather -. -no-deps ".git*" a/b/c d/e/f g/h/...
+//
+//List every .tmpl file nested any number of directories below each package,
+//skipping anything under a "testdata" directory
+//	gather -exclude "**/testdata/**" "**/*.tmpl" ./...
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 
-	"github.com/jimmyfrasche/goutil"
-	"github.com/jimmyfrasche/goutil/gocli"
+	"golang.org/x/tools/go/packages"
 )
 
 var (
-	tags    = gocli.TagsFlag("")
-	stdlib  = flag.Bool("stdlib", false, "include standard library packages in search")
-	noDeps  = flag.Bool("no-deps", false, "do not search dependencies of specified packages")
-	exclude = flag.String("exclude", "", "glob of files to exclude")
-	rel     = flag.String("rel", "", "print all results relative to a given directory")
-	print0  = flag.Bool("print0", false, "separate filenames by NUL")
-	dot     = flag.Bool(".", false, "include dot files")
-	faildup = flag.Bool("fail-on-dup", false, "fail if two files have the same name")
+	tags      = flag.String("tags", "", "build tags, as per go(1)")
+	stdlib    = flag.Bool("stdlib", false, "include standard library packages in search")
+	noDeps    = flag.Bool("no-deps", false, "do not search dependencies of specified packages")
+	exclude   = flag.String("exclude", "", "glob of files to exclude")
+	rel       = flag.String("rel", "", "print all results relative to a given directory")
+	print0    = flag.Bool("print0", false, "separate filenames by NUL")
+	dot       = flag.Bool(".", false, "include dot files")
+	faildup   = flag.Bool("fail-on-dup", false, "fail if two files have the same name")
+	overlay   = flag.String("overlay", "", "JSON file-overlay map, as per go(1)'s -overlay")
+	jobs      = flag.Int("j", runtime.NumCPU(), "number of packages to process concurrently")
+	doSort    = flag.Bool("sort", false, "print results in deterministic (package) order")
+	outDir    = flag.String("o", "", "copy matched files into DIR instead of printing them")
+	layout    = flag.String("copy-layout", "flat", "layout for -o: flat, import-path, or module-relative")
+	jsonOut   = flag.Bool("json", false, "emit one JSON object per matched file instead of plain text")
+	jsonArray = flag.Bool("json-array", false, "with -json, emit a single JSON array instead of one object per line")
 )
 
-func importArgs(tags, imports []string) (goutil.Packages, error) {
-	ctx := goutil.Context(tags...)
-	pss, err := gocli.FirstError(gocli.Import(false, ctx, imports))
-	if err != nil {
-		return nil, err
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
 	}
-	return gocli.Flatten(pss), nil
+	return strings.Split(tags, ",")
 }
 
-func importDeps(ps goutil.Packages) (goutil.Packages, error) {
-	var deps goutil.Packages
-	for _, p := range ps {
-		ds, err := p.ImportDeps()
+//match finds the files in dir matching pattern but not exclude, unioning
+//in any matching overlay files. A pattern or exclude containing "/"
+//switches to the recursive, "**"-aware grammar (see walkMatch); otherwise
+//dir is globbed non-recursively, same as always. boundaries holds every
+//loaded package's directory, so a recursive walk rooted at one package
+//doesn't cross into a nested package's files and report them twice.
+func match(dir, pattern, exclude string, overlay map[string]string, includeDot bool, boundaries map[string]bool) ([]string, error) {
+	if isRecursivePattern(pattern) || isRecursivePattern(exclude) {
+		out, err := walkMatch(dir, pattern, exclude, includeDot, boundaries)
+		if err != nil {
+			return nil, err
+		}
+		extra, err := overlayWalkMatch(dir, pattern, exclude, overlay, includeDot, boundaries)
 		if err != nil {
 			return nil, err
 		}
-		deps = append(deps, ds...)
+		return append(out, extra...), nil
 	}
 
-	return append(ps, deps...).Uniq(), nil
-}
+	out, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	// union in any overlay files that live in dir and match pattern: the
+	// emitted path is the logical (keyed) path, not the one holding the
+	// real contents.
+	for logical := range overlay {
+		if filepath.Dir(logical) != dir {
+			continue
+		}
+		ok, err := filepath.Match(pattern, filepath.Base(logical))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, logical)
+		}
+	}
 
-func match(dir, pattern string) ([]string, error) {
-	p := filepath.Join(dir, pattern)
-	return filepath.Glob(p)
+	if !includeDot {
+		if out, err = filter(out, ".*"); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if out, err = filter(out, exclude); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
 }
 
 func filter(paths []string, exclude string) ([]string, error) {
@@ -156,29 +239,6 @@ func mkFormatter(rel string) (pathFormatter, error) {
 	return mkRel(rel), nil
 }
 
-func format(paths []string, f pathFormatter) ([]string, error) {
-	var out []string
-	for _, p := range paths {
-		s, err := f(p)
-		if err != nil {
-			return nil, err
-		}
-		out = append(out, s)
-	}
-	return out, nil
-}
-
-type dupcheck map[string]string
-
-func (d dupcheck) push(p string) error {
-	b := filepath.Base(p)
-	if o, ok := d[b]; ok {
-		return fmt.Errorf("duplicate file %s found at\n\t%s\npreviously\n\t%s", b, p, o)
-	}
-	d[b] = p
-	return nil
-}
-
 //Usage: %name $flags import-path*
 func main() {
 	log.SetFlags(0)
@@ -192,74 +252,167 @@ func main() {
 		pat, args = args[0], args[1:]
 	}
 
+	// load the file overlay, if any
+	overlayReplace, err := loadOverlay(*overlay)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	overlayContent, err := packagesOverlay(overlayReplace)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	// select packages
-	ps, err := importArgs(*tags, args)
+	ps, err := loadPackages(splitTags(*tags), overlayContent, args)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	// load dependencies of selected packages, unless told otherwise
 	if !*noDeps {
-		ps, err = importDeps(ps)
-		if err != nil {
-			log.Fatalln(err)
-		}
+		ps = closure(ps)
 	}
 
 	// filter out standard library packages, unless told otherwise
 	if !*stdlib {
-		ps = ps.NoStdlib()
+		ps = noStdlib(ps)
 	}
 
-	// build our path formatter
-	formatter, err := mkFormatter(*rel)
-	if err != nil {
-		log.Fatalln(err)
+	// a package with no files to derive a directory from (e.g. NeedFiles
+	// wasn't satisfied) can't be searched; skip it rather than guessing
+	// at a directory, which would silently produce wrong results
+	kept := ps[:0]
+	for _, p := range ps {
+		if pkgDir(p) == "" {
+			log.Printf("skipping %s: no directory found for package", p.PkgPath)
+			continue
+		}
+		kept = append(kept, p)
 	}
+	ps = kept
 
-	// choose our separator
+	// every loaded package's directory, so a recursive pattern rooted at
+	// one package stops at a nested package's directory instead of
+	// reporting its files a second time
+	boundaries := make(map[string]bool, len(ps))
+	for _, p := range ps {
+		if d := pkgDir(p); d != "" {
+			boundaries[d] = true
+		}
+	}
+
+	// choose our output format and, from it, our separator
+	format := chooseFormat(*print0, *jsonOut, *jsonArray)
 	sep := "\n"
-	if *print0 {
+	if format == formatNUL {
 		sep = string([]rune{0})
 	}
 
-	dups := dupcheck{}
-	for _, p := range ps {
-		//find matching files
-		ms, err := match(p.Build.Dir, pat)
+	// build our sink: print to stdout, or copy into -o's tree
+	var sk sink
+	if *outDir != "" {
+		if *jsonOut || *jsonArray {
+			log.Fatalln("-json and -json-array cannot be combined with -o")
+		}
+		cl, err := parseCopyLayout(*layout)
 		if err != nil {
 			log.Fatalln(err)
 		}
+		sk = newCopySink(*outDir, cl, *faildup)
+	} else {
+		formatter, err := mkFormatter(*rel)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		sk = newPrintSink(formatter, *faildup, format)
+	}
+
+	// process each package's directory concurrently: match, filter, sink
+	process := func(p *packages.Package) ([]string, error) {
+		ms, err := match(pkgDir(p), pat, *exclude, overlayReplace, *dot, boundaries)
+		if err != nil {
+			return nil, err
+		}
 
-		// unless told otherwise, filter out dot files
-		if !*dot {
-			ms, err = filter(ms, ".*")
+		var lines []string
+		for _, m := range ms {
+			line, err := sk.put(p, m, pat)
 			if err != nil {
-				log.Fatalln(err)
+				return nil, err
+			}
+			if line != "" {
+				lines = append(lines, line)
 			}
 		}
+		return lines, nil
+	}
 
-		// filter out any exclusions
-		ms, err = filter(ms, *exclude)
-		if err != nil {
-			log.Fatalln(err)
+	results, wait := gather(context.Background(), ps, *jobs, process)
+
+	printResult := func(r pkgResult) {
+		for _, m := range r.lines {
+			fmt.Printf("%s%s", m, sep)
 		}
+	}
 
-		// format paths
-		ms, err = format(ms, formatter)
-		if err != nil {
+	// -json-array wraps every matched file's object in one top-level
+	// array, so it has to buffer the whole run and print it in one go;
+	// it's always in package order, since an array shuffled by whichever
+	// goroutine happened to finish first would be far more surprising
+	// than a merely unsorted stream of text/NUL/jsonl lines is.
+	if format == formatJSON {
+		all := make([]pkgResult, 0, len(ps))
+		for r := range results {
+			all = append(all, r)
+		}
+		if err := wait(); err != nil {
 			log.Fatalln(err)
 		}
-
-		//print formatted files, error if duplicate and we're checking for them
-		for _, m := range ms {
-			if *faildup {
-				err = dups.push(m)
-				if *faildup && err != nil {
-					log.Fatalln(err)
+		sort.Slice(all, func(i, j int) bool { return all[i].index < all[j].index })
+		fmt.Print("[")
+		first := true
+		for _, r := range all {
+			for _, m := range r.lines {
+				if !first {
+					fmt.Print(",")
 				}
+				first = false
+				fmt.Print(m)
 			}
-			fmt.Printf("%s%s", m, sep)
 		}
+		fmt.Println("]")
+		if err := sk.close(); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	// -sort trades streaming output for a deterministic, per-package order
+	if *doSort {
+		all := make([]pkgResult, 0, len(ps))
+		for r := range results {
+			all = append(all, r)
+		}
+		if err := wait(); err != nil {
+			log.Fatalln(err)
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].index < all[j].index })
+		for _, r := range all {
+			printResult(r)
+		}
+		if err := sk.close(); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	for r := range results {
+		printResult(r)
+	}
+	if err := wait(); err != nil {
+		log.Fatalln(err)
+	}
+	if err := sk.close(); err != nil {
+		log.Fatalln(err)
 	}
 }
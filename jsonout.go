@@ -0,0 +1,40 @@
+package main
+
+//outputFormat selects how matched files are written to stdout. text and
+//nul are the original plain-path formats; jsonl and json are structured,
+//the latter wrapping every record in a single top-level array for jq.
+type outputFormat int
+
+const (
+	formatText outputFormat = iota
+	formatNUL
+	formatJSONL
+	formatJSON
+)
+
+//chooseFormat resolves the possibly-overlapping -print0/-json/-json-array
+//flags to a single outputFormat, most specific first.
+func chooseFormat(print0, jsonFlag, jsonArray bool) outputFormat {
+	switch {
+	case jsonArray:
+		return formatJSON
+	case jsonFlag:
+		return formatJSONL
+	case print0:
+		return formatNUL
+	default:
+		return formatText
+	}
+}
+
+//record is the structured form of a matched file emitted by -json and
+//-json-array, mirroring the attribution go list -json gives a package.
+type record struct {
+	Path     string
+	Rel      string
+	Package  string
+	Module   string `json:"Module,omitempty"`
+	Dir      string
+	Matched  string
+	IsStdlib bool
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestChooseFormat(t *testing.T) {
+	tests := []struct {
+		print0, jsonFlag, jsonArray bool
+		want                        outputFormat
+	}{
+		{false, false, false, formatText},
+		{true, false, false, formatNUL},
+		{false, true, false, formatJSONL},
+		{false, false, true, formatJSON},
+		// -json-array implies -json; most specific wins regardless of
+		// what else is set.
+		{true, true, true, formatJSON},
+		{true, true, false, formatJSONL},
+	}
+	for _, tc := range tests {
+		if got := chooseFormat(tc.print0, tc.jsonFlag, tc.jsonArray); got != tc.want {
+			t.Errorf("chooseFormat(%v, %v, %v) = %v, want %v", tc.print0, tc.jsonFlag, tc.jsonArray, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+//loadPackages resolves import path patterns (including the "..." syntax)
+//to their packages.Package representation, honoring the given build tags
+//and file overlay.
+func loadPackages(tags []string, overlay map[string][]byte, patterns []string) ([]*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports |
+			packages.NeedDeps | packages.NeedModule,
+		Overlay: overlay,
+	}
+	if len(tags) != 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(tags, ",")}
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	if n := packages.PrintErrors(pkgs); n > 0 {
+		return nil, fmt.Errorf("%d error(s) loading packages", n)
+	}
+	return pkgs, nil
+}
+
+//closure returns pkgs plus the transitive closure of their dependencies,
+//deduplicated by import path. The result is in visit order, not map
+//order, so it stays deterministic given the same pkgs.
+func closure(pkgs []*packages.Package) []*packages.Package {
+	seen := map[string]bool{}
+	var out []*packages.Package
+	var walk func(p *packages.Package)
+	walk = func(p *packages.Package) {
+		if seen[p.PkgPath] {
+			return
+		}
+		seen[p.PkgPath] = true
+		out = append(out, p)
+
+		// p.Imports is a map; walk it in a fixed order so the result
+		// doesn't reshuffle from one run to the next.
+		importPaths := make([]string, 0, len(p.Imports))
+		for ip := range p.Imports {
+			importPaths = append(importPaths, ip)
+		}
+		sort.Strings(importPaths)
+		for _, ip := range importPaths {
+			walk(p.Imports[ip])
+		}
+	}
+	for _, p := range pkgs {
+		walk(p)
+	}
+	return out
+}
+
+//noStdlib filters out any packages belonging to the standard library.
+func noStdlib(pkgs []*packages.Package) []*packages.Package {
+	out := pkgs[:0]
+	for _, p := range pkgs {
+		if !isStdlib(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+//isStdlib reports whether p is part of the standard library: it belongs
+//to no module and lives under $GOROOT/src.
+func isStdlib(p *packages.Package) bool {
+	if p.Module != nil {
+		return false
+	}
+	dir := pkgDir(p)
+	if dir == "" {
+		return false
+	}
+	return strings.HasPrefix(dir, filepath.Join(runtime.GOROOT(), "src")+string(filepath.Separator)) ||
+		dir == filepath.Join(runtime.GOROOT(), "src")
+}
+
+//pkgDir returns the directory containing p, derived from its file lists
+//since packages.Package carries no Dir field of its own. It returns ""
+//if p has no files to derive one from (e.g. NeedFiles wasn't set, or
+//p.Module.Dir would be the only way to guess, which is wrong: that's the
+//module root, not this package's directory). Callers must treat "" as
+//"skip this package", not fall back to some other directory.
+func pkgDir(p *packages.Package) string {
+	switch {
+	case len(p.GoFiles) != 0:
+		return filepath.Dir(p.GoFiles[0])
+	case len(p.OtherFiles) != 0:
+		return filepath.Dir(p.OtherFiles[0])
+	case len(p.EmbedFiles) != 0:
+		return filepath.Dir(p.EmbedFiles[0])
+	case len(p.IgnoredFiles) != 0:
+		return filepath.Dir(p.IgnoredFiles[0])
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+//chdirFixture switches into the loadfixture testdata module for the
+//duration of the test, restoring the original directory on cleanup.
+//loadPackages has no Dir option of its own; it resolves patterns
+//relative to the process's working directory, same as go(1) itself.
+//Safe to call more than once per test: it always measures from the
+//directory the test started in, not wherever a previous call left it.
+func chdirFixture(t *testing.T, sub string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := wd
+	t.Cleanup(func() {
+		if err := os.Chdir(root); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	dir := filepath.Join(root, "testdata", "loadfixture", sub)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadOne(t *testing.T, sub string, patterns ...string) *packages.Package {
+	t.Helper()
+	chdirFixture(t, sub)
+	ps, err := loadPackages(nil, nil, patterns)
+	if err != nil {
+		t.Fatalf("loadPackages: %v", err)
+	}
+	if len(ps) != 1 {
+		t.Fatalf("loadPackages(%v) returned %d packages, want 1", patterns, len(ps))
+	}
+	return ps[0]
+}
+
+func TestPkgDirFromGoFiles(t *testing.T) {
+	p := loadOne(t, "pkg", ".")
+	dir := pkgDir(p)
+	want := filepath.Join(p.Module.Dir, "pkg")
+	if dir != want {
+		t.Errorf("pkgDir = %q, want %q", dir, want)
+	}
+}
+
+func TestPkgDirNoFilesReturnsEmpty(t *testing.T) {
+	p := loadOne(t, "testonly", ".")
+	if len(p.GoFiles) != 0 || len(p.OtherFiles) != 0 || len(p.EmbedFiles) != 0 || len(p.IgnoredFiles) != 0 {
+		t.Skip("fixture package unexpectedly has file-derived info; nothing to test")
+	}
+	if dir := pkgDir(p); dir != "" {
+		t.Errorf("pkgDir = %q for a package with no file lists, want \"\" (must not fabricate the module root)", dir)
+	}
+}
+
+func TestIsStdlib(t *testing.T) {
+	chdirFixture(t, "pkg")
+
+	ps, err := loadPackages(nil, nil, []string{".", "fmt"})
+	if err != nil {
+		t.Fatalf("loadPackages: %v", err)
+	}
+	if len(ps) != 2 {
+		t.Fatalf("loadPackages(., fmt) returned %d packages, want 2", len(ps))
+	}
+
+	for _, p := range ps {
+		want := p.PkgPath == "fmt"
+		if got := isStdlib(p); got != want {
+			t.Errorf("isStdlib(%s) = %v, want %v", p.PkgPath, got, want)
+		}
+	}
+}
+
+func TestClosureVisitsDepsInDeterministicOrder(t *testing.T) {
+	chdirFixture(t, "pkg")
+	ps, err := loadPackages(nil, nil, []string{"."})
+	if err != nil {
+		t.Fatalf("loadPackages: %v", err)
+	}
+
+	first := closure(ps)
+	for i := 0; i < 5; i++ {
+		again := closure(ps)
+		if len(again) != len(first) {
+			t.Fatalf("closure returned %d packages on run %d, want %d", len(again), i, len(first))
+		}
+		for j := range first {
+			if again[j].PkgPath != first[j].PkgPath {
+				t.Fatalf("closure order changed on run %d: got %q at index %d, want %q", i, again[j].PkgPath, j, first[j].PkgPath)
+			}
+		}
+	}
+
+	var sawSub bool
+	for _, p := range first {
+		if p.PkgPath == "loadfixture/sub" {
+			sawSub = true
+		}
+	}
+	if !sawSub {
+		t.Errorf("closure(%v) did not include the imported loadfixture/sub package", ps)
+	}
+}
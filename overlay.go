@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+//overlayFile mirrors the JSON shape accepted by go(1)'s -overlay flag:
+//a map from a logical file path to the path of the file whose contents
+//should be used in its place.
+type overlayFile struct {
+	Replace map[string]string `json:"Replace"`
+}
+
+//loadOverlay reads the -overlay JSON file at path and returns its
+//Replace map. An empty path is not an error; it yields a nil map.
+func loadOverlay(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var o overlayFile
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, err
+	}
+	return o.Replace, nil
+}
+
+//packagesOverlay reads the contents of each replacement file so the
+//result can be handed to packages.Config.Overlay, which wants file
+//contents rather than a second path.
+func packagesOverlay(replace map[string]string) (map[string][]byte, error) {
+	if len(replace) == 0 {
+		return nil, nil
+	}
+	out := make(map[string][]byte, len(replace))
+	for logical, actual := range replace {
+		b, err := os.ReadFile(actual)
+		if err != nil {
+			return nil, err
+		}
+		out[logical] = b
+	}
+	return out, nil
+}
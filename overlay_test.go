@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOverlayEmptyPath(t *testing.T) {
+	replace, err := loadOverlay("")
+	if err != nil {
+		t.Fatalf("loadOverlay(\"\"): %v", err)
+	}
+	if replace != nil {
+		t.Errorf("loadOverlay(\"\") = %v, want nil", replace)
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "overlay.json")
+	contents := `{"Replace": {"/logical/a.txt": "/actual/a.txt", "/logical/b.txt": "/actual/b.txt"}}`
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	replace, err := loadOverlay(path)
+	if err != nil {
+		t.Fatalf("loadOverlay: %v", err)
+	}
+	want := map[string]string{"/logical/a.txt": "/actual/a.txt", "/logical/b.txt": "/actual/b.txt"}
+	if len(replace) != len(want) {
+		t.Fatalf("loadOverlay = %v, want %v", replace, want)
+	}
+	for k, v := range want {
+		if replace[k] != v {
+			t.Errorf("loadOverlay[%q] = %q, want %q", k, replace[k], v)
+		}
+	}
+}
+
+func TestPackagesOverlayEmpty(t *testing.T) {
+	out, err := packagesOverlay(nil)
+	if err != nil {
+		t.Fatalf("packagesOverlay(nil): %v", err)
+	}
+	if out != nil {
+		t.Errorf("packagesOverlay(nil) = %v, want nil", out)
+	}
+}
+
+func TestPackagesOverlayReadsContents(t *testing.T) {
+	dir := t.TempDir()
+	actual := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(actual, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := packagesOverlay(map[string]string{"/logical/a.txt": actual})
+	if err != nil {
+		t.Fatalf("packagesOverlay: %v", err)
+	}
+	if string(out["/logical/a.txt"]) != "hello" {
+		t.Errorf("packagesOverlay contents = %q, want %q", out["/logical/a.txt"], "hello")
+	}
+}
+
+func TestPackagesOverlayMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := packagesOverlay(map[string]string{"/logical/a.txt": filepath.Join(dir, "missing.txt")}); err == nil {
+		t.Error("packagesOverlay: want error for a missing replacement file, got nil")
+	}
+}
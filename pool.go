@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+//pkgResult is one package's contribution to the gathered file list.
+type pkgResult struct {
+	index int
+	lines []string
+}
+
+//processFunc computes the matched, filtered, formatted lines for a single package.
+type processFunc func(*packages.Package) ([]string, error)
+
+//gather runs process over each package in ps using up to workers goroutines
+//and streams results back over the returned channel as they complete, in
+//whatever order workers finish. The first error encountered cancels any
+//work still queued; call the returned wait func after draining the
+//channel to pick it up.
+func gather(ctx context.Context, ps []*packages.Package, workers int, process processFunc) (<-chan pkgResult, func() error) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(ps) {
+		workers = len(ps)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	jobs := make(chan int)
+	results := make(chan pkgResult)
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				lines, err := process(ps[idx])
+				if err != nil {
+					setErr(err)
+					continue
+				}
+				select {
+				case results <- pkgResult{index: idx, lines: lines}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range ps {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+		cancel()
+	}()
+
+	wait := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr
+	}
+	return results, wait
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func drain(results <-chan pkgResult) []pkgResult {
+	var out []pkgResult
+	for r := range results {
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestGatherCollectsAllResults(t *testing.T) {
+	ps := make([]*packages.Package, 5)
+	for i := range ps {
+		ps[i] = &packages.Package{}
+	}
+
+	process := func(p *packages.Package) ([]string, error) {
+		for i, q := range ps {
+			if q == p {
+				return []string{fmt.Sprintf("line%d", i)}, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown package")
+	}
+
+	results, wait := gather(context.Background(), ps, 2, process)
+	all := drain(results)
+	if err := wait(); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if len(all) != len(ps) {
+		t.Fatalf("got %d results, want %d", len(all), len(ps))
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].index < all[j].index })
+	for i, r := range all {
+		if r.index != i {
+			t.Errorf("result %d has index %d", i, r.index)
+		}
+		want := fmt.Sprintf("line%d", i)
+		if len(r.lines) != 1 || r.lines[0] != want {
+			t.Errorf("result %d lines = %v, want [%s]", i, r.lines, want)
+		}
+	}
+}
+
+func TestGatherStopsOnFirstError(t *testing.T) {
+	ps := make([]*packages.Package, 20)
+	for i := range ps {
+		ps[i] = &packages.Package{}
+	}
+
+	wantErr := errors.New("boom")
+	var failed int
+	process := func(p *packages.Package) ([]string, error) {
+		for i, q := range ps {
+			if q == p && i == 0 {
+				return nil, wantErr
+			}
+		}
+		failed++
+		return nil, nil
+	}
+
+	results, wait := gather(context.Background(), ps, 1, process)
+	drain(results)
+	if err := wait(); !errors.Is(err, wantErr) {
+		t.Fatalf("wait() = %v, want %v", err, wantErr)
+	}
+	// With a single worker, failing on the first job should cancel before
+	// every remaining job runs.
+	if failed == len(ps)-1 {
+		t.Errorf("all remaining jobs ran despite the error; cancellation did not take effect")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+//dupcheck tracks the first path seen for each basename. It is shared by
+//every worker in the pool, so access is guarded by a mutex.
+type dupcheck struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func newDupcheck() *dupcheck {
+	return &dupcheck{m: map[string]string{}}
+}
+
+func (d *dupcheck) push(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b := filepath.Base(p)
+	if o, ok := d.m[b]; ok {
+		return fmt.Errorf("duplicate file %s found at\n\t%s\npreviously\n\t%s", b, p, o)
+	}
+	d.m[b] = p
+	return nil
+}
+
+//sink is where a matched file ends up: printed to stdout, or copied into
+//a destination tree. put is called once per matched file, possibly from
+//several goroutines at once, so implementations must be safe for
+//concurrent use.
+type sink interface {
+	//put records one match for pattern matched from package p at
+	//absolute path src. It returns a line to print, or "" if the sink
+	//handles its own output (or defers it to close).
+	put(p *packages.Package, src, matched string) (string, error)
+	close() error
+}
+
+//printSink formats each matched path and, for the JSON formats, marshals
+//it to a record; either way it hands the result back as a line for the
+//caller to print. For formatJSON the caller (main) is responsible for
+//assembling those lines into the single top-level array, so that output
+//goes through the same pkgResult/-sort ordering as every other format.
+type printSink struct {
+	format  pathFormatter
+	faildup bool
+	dups    *dupcheck
+	out     outputFormat
+}
+
+func newPrintSink(format pathFormatter, faildup bool, out outputFormat) *printSink {
+	return &printSink{format: format, faildup: faildup, dups: newDupcheck(), out: out}
+}
+
+func (s *printSink) put(p *packages.Package, src, matched string) (string, error) {
+	rel, err := s.format(src)
+	if err != nil {
+		return "", err
+	}
+	if s.faildup {
+		if err := s.dups.push(rel); err != nil {
+			return "", err
+		}
+	}
+
+	if s.out != formatJSONL && s.out != formatJSON {
+		return rel, nil
+	}
+
+	rec := record{
+		Path:     src,
+		Rel:      rel,
+		Package:  p.PkgPath,
+		Dir:      pkgDir(p),
+		Matched:  matched,
+		IsStdlib: isStdlib(p),
+	}
+	if p.Module != nil {
+		rec.Module = p.Module.Path
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (s *printSink) close() error {
+	return nil
+}
+
+//copyLayout controls where copySink places a file under its output directory.
+type copyLayout int
+
+const (
+	layoutFlat copyLayout = iota
+	layoutImportPath
+	layoutModuleRelative
+)
+
+func parseCopyLayout(s string) (copyLayout, error) {
+	switch s {
+	case "", "flat":
+		return layoutFlat, nil
+	case "import-path":
+		return layoutImportPath, nil
+	case "module-relative":
+		return layoutModuleRelative, nil
+	default:
+		return 0, fmt.Errorf("unknown -copy-layout %q", s)
+	}
+}
+
+//copySink stages matched files into dir, preserving mode bits and
+//following symlinks as plain files. Each file is written atomically, so
+//a failure never leaves a half-written file behind.
+type copySink struct {
+	dir     string
+	layout  copyLayout
+	faildup bool
+	dups    *dupcheck
+}
+
+func newCopySink(dir string, layout copyLayout, faildup bool) *copySink {
+	return &copySink{dir: dir, layout: layout, faildup: faildup, dups: newDupcheck()}
+}
+
+func (s *copySink) dest(p *packages.Package, src string) string {
+	base := filepath.Base(src)
+	switch s.layout {
+	case layoutImportPath:
+		return filepath.Join(s.dir, filepath.FromSlash(p.PkgPath), base)
+	case layoutModuleRelative:
+		if p.Module != nil {
+			if rel, err := filepath.Rel(p.Module.Dir, src); err == nil {
+				return filepath.Join(s.dir, rel)
+			}
+		}
+		return filepath.Join(s.dir, filepath.FromSlash(p.PkgPath), base)
+	default:
+		return filepath.Join(s.dir, base)
+	}
+}
+
+func (s *copySink) put(p *packages.Package, src, _ string) (string, error) {
+	dst := s.dest(p, src)
+
+	// -fail-on-dup only makes sense for flat layout: the other layouts
+	// can't produce a collision by construction.
+	if s.faildup && s.layout == layoutFlat {
+		if err := s.dups.push(dst); err != nil {
+			return "", err
+		}
+	}
+
+	return "", copyFile(src, dst)
+}
+
+func (s *copySink) close() error {
+	return nil
+}
+
+//copyFile copies src to dst, preserving mode bits and reading through
+//symlinks rather than recreating them. dst is written via a temp file
+//plus rename so a failed copy never leaves it half-written.
+func copyFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(src), target)
+		}
+		src = target
+		if info, err = os.Stat(src); err != nil {
+			return err
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o777); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".gather*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed into place
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
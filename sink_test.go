@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestCopyFileRegular(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	if err := os.WriteFile(src, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "out", "dst.txt")
+	if err := copyFile(src, dst); err != nil {
+		t.Fatalf("copyFile: %v", err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("ReadFile(dst): %v", err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("dst contents = %q, want %q", got, "hello")
+	}
+
+	info, err := os.Lstat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Error("dst is a symlink, want a regular file")
+	}
+}
+
+func TestCopyFileFollowsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	if err := os.WriteFile(target, []byte("real contents"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "dst.txt")
+	if err := copyFile(link, dst); err != nil {
+		t.Fatalf("copyFile: %v", err)
+	}
+
+	info, err := os.Lstat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Error("dst is a symlink, want copyFile to have followed it and written a regular file")
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("ReadFile(dst): %v", err)
+	}
+	if string(got) != "real contents" {
+		t.Errorf("dst contents = %q, want %q", got, "real contents")
+	}
+}
+
+func TestCopyFileNoPartialFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst.txt")
+
+	if err := copyFile(filepath.Join(dir, "does-not-exist.txt"), dst); err == nil {
+		t.Fatal("copyFile: want error for missing source, got nil")
+	}
+
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("dst = %v after failed copy, want it to not exist", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("dir has %d entries after failed copy, want 0 (no leftover temp file)", len(entries))
+	}
+}
+
+func TestPrintSinkJSONLine(t *testing.T) {
+	p := &packages.Package{
+		PkgPath: "example.com/pkg",
+		GoFiles: []string{"/src/example.com/pkg/file.go"},
+		Module:  &packages.Module{Path: "example.com"},
+	}
+
+	s := newPrintSink(identity, false, formatJSONL)
+	line, err := s.put(p, "/src/example.com/pkg/matched.txt", "*.txt")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	var rec record
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		t.Fatalf("line %q is not valid JSON: %v", line, err)
+	}
+	if rec.Path != "/src/example.com/pkg/matched.txt" || rec.Rel != "/src/example.com/pkg/matched.txt" ||
+		rec.Package != "example.com/pkg" || rec.Dir != "/src/example.com/pkg" ||
+		rec.Matched != "*.txt" || rec.Module != "example.com" || rec.IsStdlib {
+		t.Errorf("put() record = %+v, want a record describing the matched file", rec)
+	}
+}
+
+func TestPrintSinkJSONArrayLinesAreIndividualObjects(t *testing.T) {
+	// formatJSON must behave exactly like formatJSONL at the put/close
+	// level: main is the one that wraps the lines into a single array,
+	// using pkgResult order, so close must not buffer or emit anything.
+	p := &packages.Package{
+		PkgPath: "example.com/pkg",
+		GoFiles: []string{"/src/example.com/pkg/file.go"},
+	}
+
+	s := newPrintSink(identity, false, formatJSON)
+	line, err := s.put(p, "/src/example.com/pkg/matched.txt", "*.txt")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if line == "" {
+		t.Fatal("put() returned no line for formatJSON; caller has nothing to assemble into the array")
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		t.Fatalf("line %q is not valid JSON: %v", line, err)
+	}
+
+	if err := s.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestPrintSinkFailOnDup(t *testing.T) {
+	p := &packages.Package{GoFiles: []string{"/src/a/file.go"}}
+	s := newPrintSink(identity, true, formatText)
+
+	if _, err := s.put(p, "/src/a/dup.txt", "*"); err != nil {
+		t.Fatalf("first put: %v", err)
+	}
+	if _, err := s.put(p, "/src/b/dup.txt", "*"); err == nil {
+		t.Error("second put with a duplicate basename: want error, got nil")
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+import "loadfixture/sub"
+
+func main() {
+	_ = sub.Value
+}
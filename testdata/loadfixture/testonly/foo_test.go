@@ -0,0 +1,5 @@
+package testonly
+
+import "testing"
+
+func TestFoo(t *testing.T) {}